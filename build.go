@@ -5,8 +5,14 @@ package main
 import (
 	"archive/tar"
 	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"errors"
 	"strings"
 	"compress/gzip"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
@@ -14,6 +20,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"time"
 	"github.com/klauspost/compress/zstd"
 )
 
@@ -22,14 +29,100 @@ const (
 	opusURL     = "https://downloads.xiph.org/releases/opus/opus-" + opusVersion + ".tar.gz"
 	vendorDir   = "deps/opus"
 
-	// MSYS2 MinGW64 opus package - pre-built binaries
-	msys2OpusURL = "https://mirror.msys2.org/mingw/mingw64/mingw-w64-x86_64-opus-1.5.2-1-any.pkg.tar.zst"
-
-	// System-wide install location on Windows
-	systemInstallDir = "C:\\opus"
+	// MSYS2 package version suffix, shared across all architectures.
+	msys2PackageVersion = opusVersion + "-1-any.pkg.tar.zst"
+
+	// Digest table and bundled keyring used to verify downloaded artifacts.
+	checksumsFile = "deps/checksums.json"
+	keyringFile   = "deps/keys/opus-maintainers.gpg"
+
+	// elevatedResultFlag is the flag under which a re-launched, elevated
+	// instance of this process receives the path to write its helperResult
+	// to, so the non-elevated parent can learn whether the privileged build
+	// succeeded. It's passed as a command-line argument rather than an
+	// inherited env var: Start-Process -Verb RunAs elevates through the
+	// Application Information service (COM elevation), which builds a fresh
+	// environment block for the elevated token instead of inheriting the
+	// calling process's in-memory environment.
+	elevatedResultFlag = "--elevated-result="
 )
 
+// msys2ArchPackages maps GOARCH to the MSYS2 subrepo and package name that
+// ship a pre-built opus for that architecture.
+var msys2ArchPackages = map[string]struct{ repo, pkg string }{
+	"amd64": {"mingw64", "mingw-w64-x86_64-opus"},
+	"386":   {"mingw32", "mingw-w64-i686-opus"},
+	"arm64": {"clangarm64", "mingw-w64-clang-aarch64-opus"},
+}
+
+// msys2OpusPackageURL returns the MSYS2 mirror URL for the pre-built opus
+// package matching arch, or an error if this architecture isn't published.
+func msys2OpusPackageURL(arch string) (string, error) {
+	info, ok := msys2ArchPackages[arch]
+	if !ok {
+		return "", fmt.Errorf("no MSYS2 opus package for GOARCH %q", arch)
+	}
+	return fmt.Sprintf("https://mirror.msys2.org/mingw/%s/%s-%s", info.repo, info.pkg, msys2PackageVersion), nil
+}
+
+// systemInstallDir returns the arch-suffixed install location on Windows,
+// e.g. C:\Program Files\opus\amd64, so multiple architectures can coexist.
+func systemInstallDir(arch string) string {
+	programFiles := os.Getenv("ProgramFiles")
+	if programFiles == "" {
+		programFiles = "C:\\Program Files"
+	}
+	return filepath.Join(programFiles, "opus", arch)
+}
+
+// allowUnverified disables checksum/signature enforcement; set via
+// --allow-unverified for local development against unpinned URLs.
+var allowUnverified bool
+
 func main() {
+	// If this is the elevated child re-launched by rerunAsAdmin, run the
+	// build and report back through the result file instead of the normal
+	// flow below.
+	for _, arg := range os.Args[1:] {
+		if resultPath := strings.TrimPrefix(arg, elevatedResultFlag); resultPath != arg {
+			runElevatedHelper(resultPath)
+			return
+		}
+	}
+
+	updateChecksums := false
+	staticMode := false
+	for _, arg := range os.Args[1:] {
+		switch {
+		case arg == "--allow-unverified":
+			allowUnverified = true
+		case arg == "--update-checksums":
+			updateChecksums = true
+		case arg == "--static":
+			staticMode = true
+		case strings.HasPrefix(arg, "--mirror="):
+			mirrorBaseURL = strings.TrimPrefix(arg, "--mirror=")
+		default:
+			fatal("unknown flag: %s", arg)
+		}
+	}
+
+	if updateChecksums {
+		if err := writeChecksums(); err != nil {
+			fatal("failed to update checksums: %v", err)
+		}
+		fmt.Println("✓ deps/checksums.json updated")
+		return
+	}
+
+	if staticMode {
+		if err := buildStatic(); err != nil {
+			fatal("Static build failed: %v", err)
+		}
+		fmt.Println("✓ Static build successful!")
+		return
+	}
+
 	if err := build(); err != nil {
 		fatal("Build failed: %v", err)
 	}
@@ -37,21 +130,27 @@ func main() {
 }
 
 func build() error {
-	if runtime.GOOS == "windows" {
-		return buildWindows() 
-	}
-	
-	if runtime.GOOS == "linux" {
+	switch runtime.GOOS {
+	case "windows":
+		return buildWindows()
+	case "linux":
 		return buildLinux()
+	case "darwin":
+		return buildDarwin()
+	case "freebsd":
+		return buildFreeBSD()
+	case "openbsd":
+		return buildOpenBSD()
+	case "netbsd":
+		return buildNetBSD()
 	}
 	return nil
-
 }
 func buildLinux() error {
 	fmt.Println("Detecting available audio backends...")
 
 	// Check which backends are available
-	if hasBackendLinux("opus") {
+	if hasPkgConfigPackage("opus") {
 		fmt.Printf("  ✓ %s found\n", "opus")
 	} else {
 		err := handleNoBackendLinux()
@@ -63,11 +162,147 @@ func buildLinux() error {
 	return nil
 }
 
+// buildDarwin installs opus via whichever macOS package manager is present,
+// falling back to a source build when neither is installed.
+func buildDarwin() error {
+	fmt.Println("Detecting available audio backends...")
+	if hasPkgConfigPackage("opus") {
+		fmt.Printf("  ✓ %s found\n", "opus")
+		return nil
+	}
+
+	fmt.Println("\n❌ No audio encoder found!")
+	switch {
+	case commandExists("brew"):
+		fmt.Println("\n  brew install opus")
+		fmt.Println("\nProceed? (y/N)")
+		if !askConfirmation() {
+			return fmt.Errorf("audio backend required to build")
+		}
+		return runCmd("", "brew", "install", "opus")
+	case commandExists("port"):
+		fmt.Println("\n  sudo port install opus")
+		fmt.Println("\nProceed? (y/N)")
+		if !askConfirmation() {
+			return fmt.Errorf("audio backend required to build")
+		}
+		return runCmd("", "sudo", "port", "install", "opus")
+	default:
+		fmt.Println("Neither Homebrew nor MacPorts found, building from source...")
+		return buildFromSourceUnix()
+	}
+}
+
+func buildFreeBSD() error { return installViaPkg("freebsd") }
+func buildOpenBSD() error { return installViaPkg("openbsd") }
+func buildNetBSD() error  { return installViaPkg("netbsd") }
+
+// installViaPkg covers the *BSD family, all of which ship opus through the
+// `pkg` package manager.
+func installViaPkg(bsd string) error {
+	fmt.Println("Detecting available audio backends...")
+	if hasPkgConfigPackage("opus") {
+		fmt.Printf("  ✓ %s found\n", "opus")
+		return nil
+	}
+
+	fmt.Println("\n❌ No audio encoder found!")
+	privEsc := detectPrivilegeEscalation()
+	installArgs := []string{"pkg", "install", "-y", "opus"}
+
+	fmt.Printf("\n  # %s:\n", bsd)
+	fmt.Printf("  %s\n", commandString(privEsc, installArgs))
+	fmt.Println("\nProceed? (y/N)")
+	if !askConfirmation() {
+		return fmt.Errorf("audio backend required to build")
+	}
+
+	cmd := privilegedCommand(privEsc, installArgs)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("installation failed: %w", err)
+	}
+	fmt.Println("\n✓ Installation successful!")
+	return nil
+}
+
+// fetchAndExtractOpusSource downloads the pinned xiph.org release tarball,
+// verifies it, and extracts it under vendorDir/src, returning the resulting
+// source directory (e.g. deps/opus/src/opus-1.5.2). It's shared by every
+// build mode that compiles opus from source: buildFromSourceUnix,
+// buildStaticUnix, and buildStaticWindows.
+func fetchAndExtractOpusSource() (string, error) {
+	fmt.Println("Downloading opus source from xiph.org...")
+	os.MkdirAll(vendorDir, 0755)
+	tarPath := filepath.Join(vendorDir, "opus-"+opusVersion+".tar.gz")
+
+	if err := downloadFile(opusURL, tarPath); err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	if err := verifyDownload(tarPath, opusURL); err != nil {
+		return "", err
+	}
+
+	srcDir := filepath.Join(vendorDir, "src")
+	fmt.Println("Extracting...")
+	if err := extractTarGz(tarPath, srcDir); err != nil {
+		return "", err
+	}
+
+	return filepath.Join(srcDir, "opus-"+opusVersion), nil
+}
+
+// buildFromSourceUnix downloads and builds opus from the canonical xiph.org
+// tarball, used on macOS when neither Homebrew nor MacPorts is available.
+func buildFromSourceUnix() error {
+	buildDir, err := fetchAndExtractOpusSource()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Configuring...")
+	if err := runCmd(buildDir, "./configure"); err != nil {
+		return fmt.Errorf("configure failed: %w", err)
+	}
+
+	fmt.Println("Building...")
+	if err := runCmd(buildDir, "make", "-j4"); err != nil {
+		return fmt.Errorf("make failed: %w", err)
+	}
+
+	privEsc := detectPrivilegeEscalation()
+	installArgs := []string{"make", "install"}
+	fmt.Printf("\nInstalling requires: %s\n", commandString(privEsc, installArgs))
+	fmt.Println("Proceed? (y/N)")
+	if !askConfirmation() {
+		return fmt.Errorf("installation cancelled")
+	}
+
+	cmd := privilegedCommand(privEsc, installArgs)
+	cmd.Dir = buildDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("make install failed: %w", err)
+	}
+
+	fmt.Println("✓ Installation successful!")
+	return nil
+}
+
 func buildWindows() error {
+	arch := runtime.GOARCH
+	installDir := systemInstallDir(arch)
+	msys2URL, err := msys2OpusPackageURL(arch)
+	if err != nil {
+		return err
+	}
+
 	// Check if we need admin privileges (for installation or PATH modification)
-	systemLibPath := filepath.Join(systemInstallDir, "lib", "libopus.a")
+	systemLibPath := filepath.Join(installDir, "lib", "libopus.a")
 	needsInstall := !fileExists(systemLibPath)
-	binPath := filepath.Join(systemInstallDir, "bin")
+	binPath := filepath.Join(installDir, "bin")
 	needsPathUpdate := needsInstall || !isInSystemPath(binPath)
 
 	if needsPathUpdate && !isAdmin() {
@@ -78,7 +313,7 @@ func buildWindows() error {
 
 	// Check if already installed system-wide
 	if fileExists(systemLibPath) {
-		fmt.Printf("✓ libopus already installed at %s\n", systemInstallDir)
+		fmt.Printf("✓ libopus already installed at %s\n", installDir)
 
 		// Even if installed, ensure it's in PATH
 		if !isInSystemPath(binPath) {
@@ -96,329 +331,1094 @@ func buildWindows() error {
 		return nil
 	}
 
-	// Download and extract
-	fmt.Println("Downloading opus from MSYS2...")
-	tarPath := filepath.Join(vendorDir, "opus.tar.zst")
-	os.MkdirAll(vendorDir, 0755)
+	// Download and extract
+	fmt.Printf("Downloading opus from MSYS2 (%s)...\n", arch)
+	tarPath := filepath.Join(vendorDir, "opus.tar.zst")
+	os.MkdirAll(vendorDir, 0755)
+
+	if err := downloadFile(msys2URL, tarPath); err != nil {
+		return fmt.Errorf("download failed: %w", err)
+	}
+
+	if err := verifyDownload(tarPath, msys2URL); err != nil {
+		return err
+	}
+
+	fmt.Println("Extracting...")
+	extractDir := filepath.Join(vendorDir, "extracted")
+	if err := extractTarZst(tarPath, extractDir); err != nil {
+		return err
+	}
+	defer os.RemoveAll(extractDir)
+
+	// Copy files to system location
+	fmt.Printf("Installing to %s (requires admin privileges)...\n", installDir)
+
+	// The MSYS2 package extracts to <repo>/* structure, e.g. mingw64/*
+	msys2Root := filepath.Join(extractDir, msys2ArchPackages[arch].repo)
+
+	if err := copyDir(filepath.Join(msys2Root, "lib"), filepath.Join(installDir, "lib")); err != nil {
+		return fmt.Errorf("failed to copy lib: %w", err)
+	}
+
+	if err := copyDir(filepath.Join(msys2Root, "include"), filepath.Join(installDir, "include")); err != nil {
+		return fmt.Errorf("failed to copy include: %w", err)
+	}
+
+	if err := copyDir(filepath.Join(msys2Root, "bin"), filepath.Join(installDir, "bin")); err != nil {
+		return fmt.Errorf("failed to copy bin: %w", err)
+	}
+
+	fmt.Println("✓ Installation successful!")
+
+	// Add to PATH
+	binPath = filepath.Join(installDir, "bin")
+	fmt.Println("Adding to system PATH...")
+	if err := addToSystemPath(binPath); err != nil {
+		fmt.Printf("⚠ Warning: Could not add to PATH automatically: %v\n", err)
+		fmt.Printf("Please manually add to PATH: %s\n", binPath)
+	} else {
+		fmt.Println("✓ Added to system PATH")
+		fmt.Println("\n⚠ IMPORTANT: Restart your terminal/shell for PATH changes to take effect!")
+		fmt.Println("   After restarting, you can build your project.")
+	}
+
+	fmt.Printf("\nInstallation locations:\n")
+	fmt.Printf("  Libraries: %s\n", filepath.Join(installDir, "lib"))
+	fmt.Printf("  Headers: %s\n", filepath.Join(installDir, "include"))
+	fmt.Printf("  Binaries: %s\n", binPath)
+
+	return nil
+}
+
+// PackageManager abstracts the install/query commands for one Linux distro
+// family so buildLinux doesn't need a case for every distro. Backends are
+// tried in order and the first one whose Binary() is on PATH wins.
+type PackageManager interface {
+	Name() string
+	Binary() string
+	Packages() []string
+	InstallArgs(pkgs []string) []string
+	QueryArgs(pkg string) []string
+}
+
+type aptPackageManager struct{}
+
+func (aptPackageManager) Name() string   { return "apt" }
+func (aptPackageManager) Binary() string { return "apt-get" }
+func (aptPackageManager) Packages() []string {
+	return []string{"opus-tools", "libopus0", "libopus-dev"}
+}
+func (aptPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"apt-get", "install", "-y"}, pkgs...)
+}
+func (aptPackageManager) QueryArgs(pkg string) []string { return []string{"dpkg", "-s", pkg} }
+
+type dnfPackageManager struct{}
+
+func (dnfPackageManager) Name() string       { return "dnf" }
+func (dnfPackageManager) Binary() string     { return "dnf" }
+func (dnfPackageManager) Packages() []string { return []string{"opus-devel", "opusfile-devel"} }
+func (dnfPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"dnf", "install", "-y"}, pkgs...)
+}
+func (dnfPackageManager) QueryArgs(pkg string) []string { return []string{"rpm", "-q", pkg} }
+
+type yumPackageManager struct{}
+
+func (yumPackageManager) Name() string       { return "yum" }
+func (yumPackageManager) Binary() string     { return "yum" }
+func (yumPackageManager) Packages() []string { return []string{"opus-devel", "opusfile-devel"} }
+func (yumPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"yum", "install", "-y"}, pkgs...)
+}
+func (yumPackageManager) QueryArgs(pkg string) []string { return []string{"rpm", "-q", pkg} }
+
+type pacmanPackageManager struct{}
+
+func (pacmanPackageManager) Name() string       { return "pacman" }
+func (pacmanPackageManager) Binary() string     { return "pacman" }
+func (pacmanPackageManager) Packages() []string { return []string{"opus"} }
+func (pacmanPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"pacman", "-S", "--noconfirm"}, pkgs...)
+}
+func (pacmanPackageManager) QueryArgs(pkg string) []string { return []string{"pacman", "-Q", pkg} }
+
+type apkPackageManager struct{}
+
+func (apkPackageManager) Name() string       { return "apk" }
+func (apkPackageManager) Binary() string     { return "apk" }
+func (apkPackageManager) Packages() []string { return []string{"opus", "opus-dev"} }
+func (apkPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"apk", "add"}, pkgs...)
+}
+func (apkPackageManager) QueryArgs(pkg string) []string { return []string{"apk", "info", "-e", pkg} }
+
+type zypperPackageManager struct{}
+
+func (zypperPackageManager) Name() string   { return "zypper" }
+func (zypperPackageManager) Binary() string { return "zypper" }
+func (zypperPackageManager) Packages() []string {
+	return []string{"libopus0", "opus-devel"}
+}
+func (zypperPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"zypper", "install", "-y"}, pkgs...)
+}
+func (zypperPackageManager) QueryArgs(pkg string) []string { return []string{"rpm", "-q", pkg} }
+
+type xbpsPackageManager struct{}
+
+func (xbpsPackageManager) Name() string       { return "xbps" }
+func (xbpsPackageManager) Binary() string     { return "xbps-install" }
+func (xbpsPackageManager) Packages() []string { return []string{"opus"} }
+func (xbpsPackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"xbps-install", "-y"}, pkgs...)
+}
+func (xbpsPackageManager) QueryArgs(pkg string) []string { return []string{"xbps-query", pkg} }
+
+type emergePackageManager struct{}
+
+func (emergePackageManager) Name() string       { return "emerge" }
+func (emergePackageManager) Binary() string     { return "emerge" }
+func (emergePackageManager) Packages() []string { return []string{"media-libs/opus"} }
+func (emergePackageManager) InstallArgs(pkgs []string) []string {
+	return append([]string{"emerge"}, pkgs...)
+}
+func (emergePackageManager) QueryArgs(pkg string) []string { return []string{"equery", "list", pkg} }
+
+// linuxPackageManagers lists every supported backend in detection order.
+var linuxPackageManagers = []PackageManager{
+	aptPackageManager{},
+	dnfPackageManager{},
+	yumPackageManager{},
+	pacmanPackageManager{},
+	apkPackageManager{},
+	zypperPackageManager{},
+	xbpsPackageManager{},
+	emergePackageManager{},
+}
+
+// detectPackageManager probes commandExists for each backend's binary and
+// returns the first one found on PATH.
+func detectPackageManager() (PackageManager, error) {
+	for _, pm := range linuxPackageManagers {
+		if commandExists(pm.Binary()) {
+			return pm, nil
+		}
+	}
+	return nil, fmt.Errorf("no supported package manager found (tried apt, dnf, yum, pacman, apk, zypper, xbps, emerge)")
+}
+
+// detectPrivilegeEscalation returns the preferred privilege-escalation
+// command (sudo, doas, or pkexec) available on PATH, or "" if already root.
+// sudo and doas need a controlling TTY to prompt for a password; under
+// `go generate` there often isn't one, so pkexec's graphical polkit prompt
+// is preferred in that case instead of dropping the user into a prompt that
+// can't be answered.
+func detectPrivilegeEscalation() string {
+	if os.Geteuid() == 0 {
+		return ""
+	}
+
+	preferred := []string{"sudo", "doas", "pkexec"}
+	if !hasControllingTTY() {
+		preferred = []string{"pkexec", "sudo", "doas"}
+	}
+
+	for _, cmd := range preferred {
+		if commandExists(cmd) {
+			return cmd
+		}
+	}
+	return ""
+}
+
+func hasControllingTTY() bool {
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		return false
+	}
+	tty.Close()
+	return true
+}
+
+func commandString(privEsc string, args []string) string {
+	if privEsc != "" {
+		args = append([]string{privEsc}, args...)
+	}
+	return strings.Join(args, " ")
+}
+
+func privilegedCommand(privEsc string, args []string) *exec.Cmd {
+	if privEsc == "" {
+		return exec.Command(args[0], args[1:]...)
+	}
+	return exec.Command(privEsc, append([]string{args[0]}, args[1:]...)...)
+}
+
+// packagesInstalled reports whether pm already considers every one of pkgs
+// installed, via its QueryArgs. Used to catch the case where the opus
+// package is installed but pkg-config can't find it (e.g. a stale
+// PKG_CONFIG_PATH), so we don't ask the user to reinstall it.
+func packagesInstalled(pm PackageManager, pkgs []string) bool {
+	for _, pkg := range pkgs {
+		args := pm.QueryArgs(pkg)
+		if exec.Command(args[0], args[1:]...).Run() != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func handleNoBackendLinux() error {
+	fmt.Println("\n❌ No audio encoder found!")
+
+	pm, err := detectPackageManager()
+	if err != nil {
+		fmt.Println("\nYou need to install development packages for one of:")
+		fmt.Println("    - libopus")
+		return err
+	}
+
+	if packagesInstalled(pm, pm.Packages()) {
+		fmt.Printf("  ✓ %s reports opus already installed, but pkg-config can't find it\n", pm.Name())
+		fmt.Println("  Check that PKG_CONFIG_PATH includes opus's .pc file directory.")
+		return fmt.Errorf("opus installed but not visible to pkg-config")
+	}
+
+	privEsc := detectPrivilegeEscalation()
+	installArgs := pm.InstallArgs(pm.Packages())
+
+	fmt.Println("\nYou need to install the following:")
+	fmt.Printf("\n  # %s:\n", pm.Name())
+	fmt.Printf("  %s\n", commandString(privEsc, installArgs))
+
+	fmt.Println("\nWould you like to install it now? (y/N)")
+	if !askConfirmation() {
+		return fmt.Errorf("audio backend required to build")
+	}
+
+	return installBackendLinux(pm, privEsc)
+}
+
+func hasPkgConfigPackage(pkgName string) bool {
+	cmd := exec.Command("pkg-config", "--exists", pkgName)
+	return cmd.Run() == nil
+}
+
+func installBackendLinux(pm PackageManager, privEsc string) error {
+	installArgs := pm.InstallArgs(pm.Packages())
+
+	fmt.Printf("Running: %s\n", commandString(privEsc, installArgs))
+	fmt.Println("\nProceed? (y/N)")
+	if !askConfirmation() {
+		return fmt.Errorf("installation cancelled")
+	}
+
+	cmd := privilegedCommand(privEsc, installArgs)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("installation failed: %w", err)
+	}
+
+	fmt.Println("\n✓ Installation successful! Retrying build...")
+	return buildLinux()
+}
+
+func askConfirmation() bool {
+	// When running under go generate, stdin is not connected to the terminal.
+	// We need to explicitly open /dev/tty to read from the terminal.
+	tty, err := os.Open("/dev/tty")
+	if err != nil {
+		fmt.Println("\nCouldn't open the terminal input, try installing the dependency yourself with the previously mentioned command.")
+		// If we can't open the terminal, default to no
+		return false
+	}
+	defer tty.Close()
+
+	reader := bufio.NewReader(tty)
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	response = strings.ToLower(strings.TrimSpace(response))
+	return response == "y" || response == "yes"
+}
+const (
+	// Guards against decompression bombs in the zstd/gzip stream: the
+	// archives we extract (MSYS2 packages, xiph release tarballs) are at
+	// most a few hundred MB uncompressed, so these limits are generous.
+	defaultMaxExtractSize    = 2 << 30 // 2 GiB
+	defaultMaxExtractEntries = 100000
+)
+
+var defaultExtractOptions = ExtractOptions{
+	MaxSize:    defaultMaxExtractSize,
+	MaxEntries: defaultMaxExtractEntries,
+}
+
+// ExtractOptions bounds a single extractTar call.
+type ExtractOptions struct {
+	MaxSize    int64 // total bytes of file content allowed across the archive; 0 = unlimited
+	MaxEntries int   // total number of tar entries allowed; 0 = unlimited
+}
+
+func extractTarZst(tarPath, dstDir string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	d, err := zstd.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return extractTar(d, dstDir, defaultExtractOptions)
+}
+
+func extractTarGz(tarPath, dstDir string) error {
+	file, err := os.Open(tarPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gzr, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gzr.Close()
+
+	return extractTar(gzr, dstDir, defaultExtractOptions)
+}
+
+// extractTar streams a tar archive from r into dstDir. It rejects entries
+// (and symlink/hardlink targets) that would escape dstDir, preserves modes
+// and mtimes, stops at the first error instead of continuing past it, and
+// enforces opts as a guard against decompression bombs.
+func extractTar(r io.Reader, dstDir string, opts ExtractOptions) error {
+	tr := tar.NewReader(r)
+
+	var totalSize int64
+	var entries int
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		entries++
+		if opts.MaxEntries > 0 && entries > opts.MaxEntries {
+			return fmt.Errorf("archive has more than %d entries, aborting", opts.MaxEntries)
+		}
+
+		target, err := safeJoin(dstDir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeXGlobalHeader:
+			continue
+
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
+				return fmt.Errorf("creating directory %s: %w", target, err)
+			}
+			os.Chtimes(target, header.ModTime, header.ModTime)
+
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("creating parent of %s: %w", target, err)
+			}
+			n, err := extractRegularFile(tr, target, header, opts.MaxSize, totalSize)
+			if err != nil {
+				return err
+			}
+			totalSize += n
+
+		case tar.TypeSymlink:
+			if err := extractSymlink(dstDir, target, header); err != nil {
+				return err
+			}
+
+		case tar.TypeLink:
+			if err := extractHardlink(dstDir, target, header); err != nil {
+				return err
+			}
+
+		default:
+			// Device nodes, FIFOs, etc. don't need to be materialized for a
+			// dependency tarball; skip them rather than failing the build.
+		}
+	}
+	return nil
+}
+
+// extractRegularFile writes one file entry, enforcing maxSize (if set)
+// against the running total alreadyWritten rather than trusting the
+// declared header.Size, and returns the number of bytes actually written.
+func extractRegularFile(tr *tar.Reader, target string, header *tar.Header, maxSize, alreadyWritten int64) (int64, error) {
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+	if err != nil {
+		return 0, fmt.Errorf("creating %s: %w", target, err)
+	}
+
+	var n int64
+	if maxSize > 0 {
+		n, err = io.CopyN(f, tr, maxSize-alreadyWritten+1)
+		if err == nil {
+			f.Close()
+			return 0, fmt.Errorf("archive exceeds max extracted size of %d bytes", maxSize)
+		}
+		if err != io.EOF {
+			f.Close()
+			return 0, fmt.Errorf("writing %s: %w", target, err)
+		}
+	} else {
+		n, err = io.Copy(f, tr)
+		if err != nil {
+			f.Close()
+			return 0, fmt.Errorf("writing %s: %w", target, err)
+		}
+	}
+
+	if err := f.Close(); err != nil {
+		return 0, fmt.Errorf("closing %s: %w", target, err)
+	}
+	os.Chtimes(target, header.ModTime, header.ModTime)
+	return n, nil
+}
+
+func extractSymlink(dstDir, target string, header *tar.Header) error {
+	if filepath.IsAbs(header.Linkname) {
+		return fmt.Errorf("symlink %s has absolute target %s", header.Name, header.Linkname)
+	}
+
+	resolved := filepath.Join(filepath.Dir(target), header.Linkname)
+	rel, err := filepath.Rel(dstDir, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("symlink %s target %s escapes destination directory", header.Name, header.Linkname)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	if err := os.Symlink(header.Linkname, target); err != nil {
+		return fmt.Errorf("creating symlink %s: %w", target, err)
+	}
+	return nil
+}
+
+func extractHardlink(dstDir, target string, header *tar.Header) error {
+	linkTarget, err := safeJoin(dstDir, header.Linkname)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	os.Remove(target)
+	if err := os.Link(linkTarget, target); err != nil {
+		return fmt.Errorf("creating hardlink %s: %w", target, err)
+	}
+	return nil
+}
+
+// safeJoin joins name onto dstDir and rejects the result if it would escape
+// dstDir (Zip-Slip), whether via "../" segments or an absolute path.
+func safeJoin(dstDir, name string) (string, error) {
+	cleaned := filepath.Clean(name)
+	if filepath.IsAbs(cleaned) {
+		return "", fmt.Errorf("tar entry has absolute path: %s", name)
+	}
+
+	target := filepath.Join(dstDir, cleaned)
+	rel, err := filepath.Rel(dstDir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("tar entry escapes destination directory: %s", name)
+	}
+	return target, nil
+}
+
+func Decompress(in io.Reader, out io.Writer) error {
+    d, err := zstd.NewReader(in)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    
+    // Copy content...
+    _, err = io.Copy(out, d)
+    return err
+}
+
+
+// buildStaticTarget names the per-platform staging directory under
+// deps/opus, e.g. "linux_amd64", so multiple GOOS/GOARCH builds can be
+// vendored side by side.
+func buildStaticTarget() string {
+	return runtime.GOOS + "_" + runtime.GOARCH
+}
+
+func staticDir() string {
+	return filepath.Join(vendorDir, buildStaticTarget())
+}
+
+// buildStatic compiles opus from source with static linking enabled and
+// stages libopus.a plus headers under deps/opus/<GOOS>_<GOARCH>/, then
+// generates cgo_flags_static.go so a `-tags static` build links against the
+// vendored archive instead of requiring libopus.so/.dll at runtime.
+func buildStatic() error {
+	target := staticDir()
+	libPath := filepath.Join(target, "lib", "libopus.a")
+
+	if fileExists(libPath) {
+		fmt.Printf("✓ Static libopus already built at %s\n", target)
+		return writeCGOFlags()
+	}
+
+	fmt.Println("Building static libopus from source...")
+	var err error
+	if runtime.GOOS == "windows" {
+		err = buildStaticWindows(target)
+	} else {
+		err = buildStaticUnix(target)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeCGOFlags()
+}
+
+// buildStaticUnix configures and builds opus with autotools on
+// Linux/macOS/BSD, the same way buildFromSourceUnix does for a dynamic
+// install but with --disable-shared so make produces a static archive.
+func buildStaticUnix(target string) error {
+	buildDir, err := fetchAndExtractOpusSource()
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Configuring static build...")
+	if err := runCmd(buildDir, "./configure", "--disable-shared", "--enable-static", "--with-pic"); err != nil {
+		return fmt.Errorf("configure failed: %w", err)
+	}
+
+	fmt.Println("Building...")
+	if err := runCmd(buildDir, "make", "-j4"); err != nil {
+		return fmt.Errorf("make failed: %w", err)
+	}
+
+	fmt.Println("Staging static library and headers...")
+	if err := os.MkdirAll(filepath.Join(target, "lib"), 0755); err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(buildDir, ".libs", "libopus.a"), filepath.Join(target, "lib", "libopus.a")); err != nil {
+		return fmt.Errorf("staging libopus.a: %w", err)
+	}
+	if err := copyDir(filepath.Join(buildDir, "include"), filepath.Join(target, "include")); err != nil {
+		return fmt.Errorf("staging headers: %w", err)
+	}
+
+	fmt.Printf("✓ Static libopus staged at %s\n", target)
+	return nil
+}
+
+// buildStaticWindows builds opus with CMake's MinGW Makefiles generator,
+// which MSYS2 ships, since opus's autotools build isn't maintained for
+// native Windows.
+func buildStaticWindows(target string) error {
+	if !commandExists("cmake") {
+		return fmt.Errorf("static Windows build requires cmake (install it via MSYS2 or https://cmake.org)")
+	}
+
+	buildDir, err := fetchAndExtractOpusSource()
+	if err != nil {
+		return err
+	}
+	cmakeBuildDir := filepath.Join(buildDir, "build-static")
+
+	fmt.Println("Configuring static build with CMake...")
+	if err := runCmd(buildDir, "cmake", "-S", ".", "-B", "build-static",
+		"-G", "MinGW Makefiles",
+		"-DBUILD_SHARED_LIBS=OFF",
+		"-DCMAKE_POSITION_INDEPENDENT_CODE=ON",
+		"-DCMAKE_BUILD_TYPE=Release"); err != nil {
+		return fmt.Errorf("cmake configure failed: %w", err)
+	}
+
+	fmt.Println("Building...")
+	if err := runCmd(buildDir, "cmake", "--build", "build-static", "--config", "Release"); err != nil {
+		return fmt.Errorf("cmake build failed: %w", err)
+	}
+
+	fmt.Println("Staging static library and headers...")
+	if err := os.MkdirAll(filepath.Join(target, "lib"), 0755); err != nil {
+		return err
+	}
+	if err := copyFile(filepath.Join(cmakeBuildDir, "libopus.a"), filepath.Join(target, "lib", "libopus.a")); err != nil {
+		return fmt.Errorf("staging libopus.a: %w", err)
+	}
+	if err := copyDir(filepath.Join(buildDir, "include"), filepath.Join(target, "include")); err != nil {
+		return fmt.Errorf("staging headers: %w", err)
+	}
+
+	fmt.Printf("✓ Static libopus staged at %s\n", target)
+	return nil
+}
+
+// writeCGOFlags generates cgo_flags_static.go, gated behind the "static"
+// build tag, pointing #cgo LDFLAGS at the vendored archive for this
+// GOOS/GOARCH so the resulting binary has no runtime dependency on
+// libopus.so/.dll.
+func writeCGOFlags() error {
+	target := buildStaticTarget()
+	ldflags := fmt.Sprintf("-L${SRCDIR}/deps/opus/%s/lib -lopus", target)
+	if runtime.GOOS != "windows" {
+		ldflags += " -lm"
+	}
+
+	content := fmt.Sprintf(`// Code generated by build.go --static. DO NOT EDIT.
 
-	if err := downloadFile(msys2OpusURL, tarPath); err != nil {
-		return fmt.Errorf("download failed: %w", err)
-	}
+//go:build static
 
-	fmt.Println("Extracting...")
-	extractDir := filepath.Join(vendorDir, "extracted")
-	if err := extractTarZst(tarPath, extractDir); err != nil {
+package opus
+
+/*
+#cgo CFLAGS: -I${SRCDIR}/deps/opus/%s/include
+#cgo LDFLAGS: %s
+*/
+import "C"
+`, target, ldflags)
+
+	if err := os.WriteFile("cgo_flags_static.go", []byte(content), 0644); err != nil {
 		return err
 	}
-	defer os.RemoveAll(extractDir)
 
-	// Copy files to system location
-	fmt.Printf("Installing to %s (requires admin privileges)...\n", systemInstallDir)
+	fmt.Println("✓ Generated cgo_flags_static.go")
+	return nil
+}
 
-	// The MSYS2 package extracts to mingw64/* structure
-	msys2Root := filepath.Join(extractDir, "mingw64")
+// checksumEntry is the pinned digest for one download URL, stored in
+// deps/checksums.json and regenerated with `go run build.go --update-checksums`
+// after a maintainer bumps opusVersion.
+type checksumEntry struct {
+	SHA256 string `json:"sha256"`
+	SHA1   string `json:"sha1,omitempty"`
+}
 
-	if err := copyDir(filepath.Join(msys2Root, "lib"), filepath.Join(systemInstallDir, "lib")); err != nil {
-		return fmt.Errorf("failed to copy lib: %w", err)
+func loadChecksums() (map[string]checksumEntry, error) {
+	data, err := os.ReadFile(checksumsFile)
+	if err != nil {
+		return nil, err
 	}
-
-	if err := copyDir(filepath.Join(msys2Root, "include"), filepath.Join(systemInstallDir, "include")); err != nil {
-		return fmt.Errorf("failed to copy include: %w", err)
+	db := map[string]checksumEntry{}
+	if err := json.Unmarshal(data, &db); err != nil {
+		return nil, err
 	}
+	return db, nil
+}
 
-	if err := copyDir(filepath.Join(msys2Root, "bin"), filepath.Join(systemInstallDir, "bin")); err != nil {
-		return fmt.Errorf("failed to copy bin: %w", err)
+// verifyDownload checks the file at path against the pinned digest for url
+// in deps/checksums.json, then attempts GPG signature verification if a
+// bundled keyring is present. It aborts the build on mismatch unless
+// --allow-unverified was passed.
+func verifyDownload(path, url string) error {
+	if allowUnverified {
+		fmt.Println("⚠ Skipping verification (--allow-unverified)")
+		return nil
 	}
 
-	fmt.Println("✓ Installation successful!")
-
-	// Add to PATH
-	binPath = filepath.Join(systemInstallDir, "bin")
-	fmt.Println("Adding to system PATH...")
-	if err := addToSystemPath(binPath); err != nil {
-		fmt.Printf("⚠ Warning: Could not add to PATH automatically: %v\n", err)
-		fmt.Printf("Please manually add to PATH: %s\n", binPath)
-	} else {
-		fmt.Println("✓ Added to system PATH")
-		fmt.Println("\n⚠ IMPORTANT: Restart your terminal/shell for PATH changes to take effect!")
-		fmt.Println("   After restarting, you can build your project.")
+	db, err := loadChecksums()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w (run with --allow-unverified to skip)", checksumsFile, err)
 	}
 
-	fmt.Printf("\nInstallation locations:\n")
-	fmt.Printf("  Libraries: %s\n", filepath.Join(systemInstallDir, "lib"))
-	fmt.Printf("  Headers: %s\n", filepath.Join(systemInstallDir, "include"))
-	fmt.Printf("  Binaries: %s\n", binPath)
-
-	return nil
-}
+	entry, ok := db[url]
+	if !ok {
+		return fmt.Errorf("no pinned checksum for %s in %s (run with --allow-unverified to skip)", url, checksumsFile)
+	}
 
-func handleNoBackendLinux() error {
-	fmt.Println("\n❌ No audio encoder found!")
-	fmt.Println("\nYou need to install one of the following:")
-
-	distro := detectDistro()
-
-	switch distro {
-	case "debian", "ubuntu":
-		fmt.Println("\n  # Debian/Ubuntu:")
-		fmt.Println("  sudo apt-get install opus-tools libopus0 libopus-dev")
-	case "fedora", "rhel", "centos":
-		fmt.Println("\n  # Fedora/RHEL/CentOS:")
-		fmt.Println("  sudo dnf opus-devel opusfile-devel")
-	case "arch":
-		fmt.Println("\n  # Arch Linux:")
-		fmt.Println("  sudo pacman -S opus")
-	default:
-		fmt.Println("\n  Please install development packages for one of:")
-		fmt.Println("    - libopus")
+	sum, err := sha256File(path)
+	if err != nil {
+		return fmt.Errorf("hashing %s: %w", path, err)
+	}
+	if sum != entry.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", path, sum, entry.SHA256)
 	}
 
-	fmt.Println("\nWould you like to install one now? (y/N)")
-	if !askConfirmation() {
-		return fmt.Errorf("audio backend required to build")
+	if entry.SHA1 != "" {
+		sum1, err := sha1File(path)
+		if err != nil {
+			return fmt.Errorf("hashing %s: %w", path, err)
+		}
+		if sum1 != entry.SHA1 {
+			return fmt.Errorf("sha1 mismatch for %s: got %s, want %s", path, sum1, entry.SHA1)
+		}
 	}
+	fmt.Printf("✓ Checksum verified for %s\n", filepath.Base(path))
 
-	return installBackendLinux(distro)
-}
+	if err := verifyGPGSignature(path, url); err != nil {
+		return err
+	}
 
-func hasBackendLinux(pkgName string) bool {
-	cmd := exec.Command("pkg-config", "--exists", pkgName)
-	return cmd.Run() == nil
+	return nil
 }
 
-// TODO: Allow for installing of backend based on user input choice
-func installBackendLinux(distro string) error {
-	var cmd *exec.Cmd
+// verifyGPGSignature fetches a detached .asc signature alongside url (the
+// convention used by xiph.org releases) and checks it against the bundled
+// keyring. Missing signatures or keyring are not fatal: the pinned checksum
+// above is the primary guard, and not every mirror publishes signatures.
+func verifyGPGSignature(path, url string) error {
+	if !fileExists(keyringFile) {
+		return nil
+	}
+	if !commandExists("gpg") {
+		fmt.Println("⚠ gpg not found, skipping signature verification")
+		return nil
+	}
 
-	switch distro {
-	case "debian", "ubuntu":
-		fmt.Println("Running: sudo apt-get install opus-tools libopus0 libopus-dev")
-		fmt.Println("\nProceed? (y/N)")
-		if !askConfirmation() {
-			return fmt.Errorf("installation cancelled")
-		}
-		cmd = exec.Command("sudo", "apt", "install", "-y", "opus-tools", "libopus0", "libopus-dev")
-	case "fedora", "rhel", "centos":
-		fmt.Println("Running: sudo dnf opus-devel opusfile-devel")
-		fmt.Println("\nProceed? (y/N)")
-		if !askConfirmation() {
-			return fmt.Errorf("installation cancelled")
-		}
-		cmd = exec.Command("sudo", "dnf", "install", "-y", "opus-devel", "opusfile-devel")
-	case "arch":
-		fmt.Println("Running: sudo pacman -S opus")
-		fmt.Println("\nProceed? (y/N)")
-		if !askConfirmation() {
-			return fmt.Errorf("installation cancelled")
-		}
-		cmd = exec.Command("sudo", "pacman", "-S", "--noconfirm", "opus")
-	default:
-		return fmt.Errorf("automatic installation not supported for your distribution")
+	sigPath := path + ".asc"
+	if err := downloadFile(url+".asc", sigPath); err != nil {
+		fmt.Println("⚠ No signature published for this download, relying on checksum only")
+		return nil
 	}
+	defer os.Remove(sigPath)
 
+	cmd := exec.Command("gpg", "--no-default-keyring", "--keyring", keyringFile, "--verify", sigPath, path)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("installation failed: %w", err)
+		return fmt.Errorf("GPG signature verification failed: %w", err)
 	}
-
-	fmt.Println("\n✓ Installation successful! Retrying build...")
-	return buildLinux()
+	fmt.Println("✓ GPG signature verified")
+	return nil
 }
 
-func askConfirmation() bool {
-	// When running under go generate, stdin is not connected to the terminal.
-	// We need to explicitly open /dev/tty to read from the terminal.
-	tty, err := os.Open("/dev/tty")
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		fmt.Println("\nCouldn't open the terminal input, try installing the dependency yourself with the previously mentioned command.")
-		// If we can't open the terminal, default to no
-		return false
+		return "", err
 	}
-	defer tty.Close()
+	defer f.Close()
 
-	reader := bufio.NewReader(tty)
-	response, err := reader.ReadString('\n')
-	if err != nil {
-		return false
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
 	}
-	response = strings.ToLower(strings.TrimSpace(response))
-	return response == "y" || response == "yes"
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
-func detectDistro() string {
-	// Check /etc/os-release
-	data, err := os.ReadFile("/etc/os-release")
+
+func sha1File(path string) (string, error) {
+	f, err := os.Open(path)
 	if err != nil {
-		return "unknown"
+		return "", err
 	}
+	defer f.Close()
 
-	content := string(data)
-	if strings.Contains(strings.ToLower(content), "ubuntu") {
-		return "ubuntu"
-	}
-	if strings.Contains(strings.ToLower(content), "debian") {
-		return "debian"
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
 	}
-	if strings.Contains(strings.ToLower(content), "fedora") {
-		return "fedora"
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeChecksums re-downloads every known artifact URL and regenerates
+// deps/checksums.json. This is a maintainer-driven step, normally run once
+// right after bumping opusVersion, not part of a regular build.
+func writeChecksums() error {
+	urls := []string{opusURL}
+	for arch := range msys2ArchPackages {
+		url, err := msys2OpusPackageURL(arch)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, url)
 	}
-	if strings.Contains(strings.ToLower(content), "rhel") || strings.Contains(strings.ToLower(content), "red hat") {
-		return "rhel"
+
+	db := map[string]checksumEntry{}
+	tmpDir, err := os.MkdirTemp("", "opus-checksums")
+	if err != nil {
+		return err
 	}
-	if strings.Contains(strings.ToLower(content), "centos") {
-		return "centos"
+	defer os.RemoveAll(tmpDir)
+
+	for _, url := range urls {
+		dst := filepath.Join(tmpDir, filepath.Base(url))
+		fmt.Printf("Downloading %s...\n", url)
+		if err := downloadFile(url, dst); err != nil {
+			return fmt.Errorf("downloading %s: %w", url, err)
+		}
+
+		sum256, err := sha256File(dst)
+		if err != nil {
+			return err
+		}
+		sum1, err := sha1File(dst)
+		if err != nil {
+			return err
+		}
+		db[url] = checksumEntry{SHA256: sum256, SHA1: sum1}
 	}
-	if strings.Contains(strings.ToLower(content), "arch") {
-		return "arch"
+
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return err
 	}
+	return os.WriteFile(checksumsFile, append(data, '\n'), 0644)
+}
+
+const (
+	downloadTimeout        = 5 * time.Minute
+	downloadMaxRetries     = 5
+	downloadRetryBaseDelay = 500 * time.Millisecond
+)
 
-	return "unknown"
+// mirrorBaseURL, set via --mirror=<url>, redirects known upstream hosts to
+// an internal mirror for air-gapped environments (the Debian snapshot
+// pattern: everything is fetched the normal way, just from a different
+// base URL).
+var mirrorBaseURL string
+
+var mirroredHosts = []string{
+	"https://downloads.xiph.org",
+	"https://mirror.msys2.org",
 }
 
-func extractTarZst(tarPath, dstDir string) error {
-	file, err := os.Open(tarPath)
-	if err != nil {
-			return err
+func applyMirror(url string) string {
+	if mirrorBaseURL == "" {
+		return url
 	}
-	defer file.Close()
+	for _, host := range mirroredHosts {
+		if strings.HasPrefix(url, host) {
+			return mirrorBaseURL + strings.TrimPrefix(url, host)
+		}
+	}
+	return url
+}
 
-	// Decompress zstd
-	d, err := zstd.NewReader(file)
-	if err != nil {
+// retryableError marks a download failure as transient (network hiccup,
+// 5xx) so retryWithBackoff retries it; anything else (404, bad flag, etc)
+// is returned to the caller immediately.
+type retryableError struct{ err error }
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+func retryWithBackoff(attempt func() error) error {
+	var lastErr error
+	for i := 0; i < downloadMaxRetries; i++ {
+		if i > 0 {
+			delay := downloadRetryBaseDelay * time.Duration(uint(1)<<uint(i-1))
+			fmt.Printf("Retrying download in %s (attempt %d/%d)...\n", delay, i+1, downloadMaxRetries)
+			time.Sleep(delay)
+		}
+
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		var re *retryableError
+		if !errors.As(err, &re) {
 			return err
+		}
+		lastErr = err
+		fmt.Printf("Download attempt failed: %v\n", err)
 	}
-	defer d.Close()
+	return fmt.Errorf("download failed after %d attempts: %w", downloadMaxRetries, lastErr)
+}
 
-	// Extract tar
-	tr := tar.NewReader(d)
-	for {
-			header, err := tr.Next()
-			if err == io.EOF {
-					break
-			}
-			if err != nil {
-					return err
-			}
+// cacheMeta is the validator pair stored alongside a cached download so the
+// next run can send a conditional request instead of re-fetching the body.
+type cacheMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
 
-			target := filepath.Join(dstDir, header.Name)
-			switch header.Typeflag {
-			case tar.TypeDir:
-					os.MkdirAll(target, 0755)
-			case tar.TypeReg:
-					os.MkdirAll(filepath.Dir(target), 0755)
-					f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-					if err != nil {
-							return err
-					}
-					io.Copy(f, tr)
-					f.Close()
-			}
+func downloadCacheDir() (string, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
 	}
-	return nil
+	dir := filepath.Join(base, "opus-build")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	return dir, nil
 }
 
-func extractTarGz(tarPath, dstDir string) error {
-	file, err := os.Open(tarPath)
+// cacheKey is keyed by both URL and opusVersion so bumping opusVersion
+// doesn't risk serving a stale cached artifact under the same URL.
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(opusVersion + "|" + url))
+	return hex.EncodeToString(sum[:])
+}
+
+func loadCacheMeta(path string) cacheMeta {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return cacheMeta{}
 	}
-	defer file.Close()
+	var m cacheMeta
+	json.Unmarshal(data, &m)
+	return m
+}
 
-	gzr, err := gzip.NewReader(file)
+// downloadFile fetches url into dest, using a cache under
+// os.UserCacheDir()/opus-build keyed by URL+opusVersion. Cached downloads
+// are revalidated with If-None-Match/If-Modified-Since, and an interrupted
+// download resumes via a Range request against its .part file. Transient
+// network/5xx errors are retried with exponential backoff.
+func downloadFile(url, dest string) error {
+	url = applyMirror(url)
+
+	cacheDir, err := downloadCacheDir()
 	if err != nil {
+		// No usable cache directory (e.g. a locked-down sandbox) - fall
+		// back to downloading straight to dest with the same retry policy.
+		return downloadDirect(url, dest)
+	}
+
+	key := cacheKey(url)
+	cachedPath := filepath.Join(cacheDir, key+".bin")
+	partPath := filepath.Join(cacheDir, key+".part")
+	metaPath := filepath.Join(cacheDir, key+".json")
+
+	if err := fetchToCache(url, cachedPath, partPath, metaPath); err != nil {
 		return err
 	}
-	defer gzr.Close()
+	return copyFile(cachedPath, dest)
+}
 
-	tr := tar.NewReader(gzr)
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
+func fetchToCache(url, cachedPath, partPath, metaPath string) error {
+	meta := loadCacheMeta(metaPath)
+
+	return retryWithBackoff(func() error {
+		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
 			return err
 		}
 
-		target := filepath.Join(dstDir, header.Name)
-		switch header.Typeflag {
-		case tar.TypeDir:
-			os.MkdirAll(target, 0755)
-		case tar.TypeReg:
-			os.MkdirAll(filepath.Dir(target), 0755)
-			f, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR, os.FileMode(header.Mode))
-			if err != nil {
+		if fileExists(cachedPath) {
+			if meta.ETag != "" {
+				req.Header.Set("If-None-Match", meta.ETag)
+			}
+			if meta.LastModified != "" {
+				req.Header.Set("If-Modified-Since", meta.LastModified)
+			}
+		}
+
+		if info, err := os.Stat(partPath); err == nil && info.Size() > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", info.Size()))
+		}
+
+		client := &http.Client{Timeout: downloadTimeout}
+		resp, err := client.Do(req)
+		if err != nil {
+			return &retryableError{fmt.Errorf("network error: %w", err)}
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			fmt.Printf("✓ Using cached %s (not modified)\n", filepath.Base(cachedPath))
+			return nil
+
+		case http.StatusOK:
+			if err := writeBody(partPath, resp.Body, false); err != nil {
 				return err
 			}
-			io.Copy(f, tr)
-			f.Close()
+
+		case http.StatusPartialContent:
+			if err := writeBody(partPath, resp.Body, true); err != nil {
+				return err
+			}
+
+		case http.StatusRequestedRangeNotSatisfiable:
+			// Our .part is stale relative to the server; drop it and let
+			// the caller's retry start over from scratch.
+			os.Remove(partPath)
+			return &retryableError{fmt.Errorf("stale partial download for %s, discarding", filepath.Base(partPath))}
+
+		default:
+			if resp.StatusCode >= 500 {
+				return &retryableError{fmt.Errorf("server error: HTTP %s", resp.Status)}
+			}
+			return fmt.Errorf("HTTP %s", resp.Status)
 		}
-	}
-	return nil
-}
 
-func Decompress(in io.Reader, out io.Writer) error {
-    d, err := zstd.NewReader(in)
-    if err != nil {
-        return err
-    }
-    defer d.Close()
-    
-    // Copy content...
-    _, err = io.Copy(out, d)
-    return err
+		newMeta := cacheMeta{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		if newMeta.ETag != "" || newMeta.LastModified != "" {
+			if data, err := json.Marshal(newMeta); err == nil {
+				os.WriteFile(metaPath, data, 0644)
+			}
+		}
+
+		return os.Rename(partPath, cachedPath)
+	})
 }
 
+func writeBody(path string, body io.Reader, resume bool) error {
+	flags := os.O_CREATE | os.O_WRONLY
+	if resume {
+		flags |= os.O_APPEND
+	} else {
+		flags |= os.O_TRUNC
+	}
 
-// func writeCGOFlags() error {
-// 	ldflags := fmt.Sprintf("-L${SRCDIR}/deps/opus/lib/%s -lopus", runtime.GOOS)
-// 	// Windows doesn't need -lm
-// 	if runtime.GOOS != "windows" {
-// 		ldflags += " -lm"
-// 	}
-//
-// 	content := fmt.Sprintf(`// Code generated by build.go. DO NOT EDIT.
-//
-// //go:build static
-//
-// package opus
-//
-// /*
-// #cgo windows CFLAGS: -I${SRCDIR}/deps/opus/include
-// #cgo windows LDFLAGS: %s
-// #cgo linux pkg-config: opus
-// */
-// import "C"
-// `, ldflags)
-//
-// 	if err := os.WriteFile("cgo_flags_static.go", []byte(content), 0644); err != nil {
-// 		return err
-// 	}
-//
-// 	fmt.Println("✓ Generated cgo_flags_static.go")
-// 	return nil
-// }
-
-func downloadFile(url, filepath string) error {
-	resp, err := http.Get(url)
+	f, err := os.OpenFile(path, flags, 0644)
 	if err != nil {
-		return err
+		return &retryableError{fmt.Errorf("opening %s: %w", path, err)}
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP %s", resp.Status)
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return &retryableError{fmt.Errorf("writing %s: %w", path, err)}
 	}
+	return f.Close()
+}
 
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+// downloadDirect is the no-cache fallback: same retry policy, no resume or
+// conditional-request support.
+func downloadDirect(url, dest string) error {
+	return retryWithBackoff(func() error {
+		client := &http.Client{Timeout: downloadTimeout}
+		resp, err := client.Get(url)
+		if err != nil {
+			return &retryableError{fmt.Errorf("network error: %w", err)}
+		}
+		defer resp.Body.Close()
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+		if resp.StatusCode != http.StatusOK {
+			if resp.StatusCode >= 500 {
+				return &retryableError{fmt.Errorf("server error: HTTP %s", resp.Status)}
+			}
+			return fmt.Errorf("HTTP %s", resp.Status)
+		}
+
+		out, err := os.Create(dest)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+
+		_, err = io.Copy(out, resp.Body)
+		return err
+	})
 }
 
 
@@ -539,30 +1539,123 @@ func isInSystemPath(dir string) bool {
 	return strings.TrimSpace(string(output)) == "true"
 }
 
+// helperResult is what the elevated child writes to the result file so the
+// waiting parent can surface a real error instead of assuming success.
+type helperResult struct {
+	Success bool   `json:"success"`
+	Log     string `json:"log"`
+	Error   string `json:"error,omitempty"`
+}
+
+// rerunAsAdmin relaunches this process elevated via UAC and blocks until it
+// finishes, then reports the real build outcome. The elevated child learns
+// where to write its result through an elevatedResultFlag command-line
+// argument rather than an inherited env var: a process launched via
+// Start-Process -Verb RunAs is elevated through the Application Information
+// service (COM elevation), which builds a fresh environment block for the
+// elevated token instead of inheriting the calling process's in-memory
+// environment, so an env var set here would never reach the child.
 func rerunAsAdmin() error {
 	if runtime.GOOS != "windows" {
 		return fmt.Errorf("only supported on Windows")
 	}
 
-	// Get the path to the Go executable and current script
-	_, err := os.Executable()
+	resultFile, err := os.CreateTemp("", "opus-build-result-*.json")
 	if err != nil {
-		return fmt.Errorf("failed to get executable path: %w", err)
+		return fmt.Errorf("failed to set up elevation handoff: %w", err)
 	}
+	resultPath := resultFile.Name()
+	resultFile.Close()
+	os.Remove(resultPath)
+	defer os.Remove(resultPath)
 
-	// Use PowerShell Start-Process with -Verb RunAs to elevate
-	// We need to re-run "go run build.go"
 	cwd, _ := os.Getwd()
-	psScript := fmt.Sprintf(`Start-Process -FilePath "go" -ArgumentList "run","build.go" -Verb RunAs -WorkingDirectory "%s" -Wait`, cwd)
+	psScript := fmt.Sprintf(`Start-Process -FilePath "go" -ArgumentList "run","build.go","%s%s" -Verb RunAs -WorkingDirectory "%s" -Wait`, elevatedResultFlag, resultPath, cwd)
 
 	cmd := exec.Command("powershell", "-NoProfile", "-ExecutionPolicy", "Bypass", "-Command", psScript)
-	err = cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("failed to elevate: %w (you may have cancelled the UAC prompt)", err)
 	}
 
-	// Exit the current non-elevated process
+	result, err := readElevatedResult(resultPath)
+	if err != nil {
+		return fmt.Errorf("elevated process exited without reporting a result: %w", err)
+	}
+	if result.Log != "" {
+		fmt.Print(result.Log)
+	}
+	if !result.Success {
+		return fmt.Errorf("elevated build failed: %s", result.Error)
+	}
+
 	fmt.Println("\n✓ Elevated process completed. You can now build your project.")
-	os.Exit(0)
 	return nil
 }
+
+// runElevatedHelper runs in the elevated child process. It captures
+// everything build() prints, runs it, and writes the outcome plus captured
+// log to resultPath for the waiting parent to pick up.
+func runElevatedHelper(resultPath string) {
+	restoreStdout := captureStdout()
+	buildErr := build()
+	log := restoreStdout()
+
+	result := helperResult{Success: buildErr == nil, Log: log}
+	if buildErr != nil {
+		result.Error = buildErr.Error()
+	}
+
+	if err := writeElevatedResult(resultPath, result); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to report elevation result: %v\n", err)
+	}
+
+	if buildErr != nil {
+		os.Exit(1)
+	}
+}
+
+// captureStdout tees everything written to os.Stdout to both the original
+// stdout and an in-memory buffer, and returns a function that restores
+// os.Stdout and yields the captured text.
+func captureStdout() func() string {
+	orig := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		return func() string { return "" }
+	}
+	os.Stdout = w
+
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		io.Copy(io.MultiWriter(orig, &buf), r)
+		close(done)
+	}()
+
+	return func() string {
+		w.Close()
+		<-done
+		os.Stdout = orig
+		return buf.String()
+	}
+}
+
+func writeElevatedResult(path string, result helperResult) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func readElevatedResult(path string) (helperResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return helperResult{}, err
+	}
+	var result helperResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return helperResult{}, err
+	}
+	return result, nil
+}
@@ -0,0 +1,172 @@
+//go:build ignore
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// tarEntry describes one entry to write into a test tar archive.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	linkname string
+	body     string
+}
+
+func buildTar(t *testing.T, entries []tarEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Typeflag: e.typeflag,
+			Linkname: e.linkname,
+			Mode:     0644,
+			Size:     int64(len(e.body)),
+		}
+		if e.typeflag == tar.TypeDir {
+			hdr.Mode = 0755
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("writing header for %s: %v", e.name, err)
+		}
+		if e.body != "" {
+			if _, err := tw.Write([]byte(e.body)); err != nil {
+				t.Fatalf("writing body for %s: %v", e.name, err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("closing tar writer: %v", err)
+	}
+	return &buf
+}
+
+func TestExtractTarRejectsMaliciousEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []tarEntry
+	}{
+		{
+			name: "zip-slip via ../ traversal",
+			entries: []tarEntry{
+				{name: "../../etc/passwd", typeflag: tar.TypeReg, body: "pwned"},
+			},
+		},
+		{
+			name: "absolute path entry",
+			entries: []tarEntry{
+				{name: "/etc/passwd", typeflag: tar.TypeReg, body: "pwned"},
+			},
+		},
+		{
+			name: "symlink with absolute target",
+			entries: []tarEntry{
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+			},
+		},
+		{
+			name: "symlink escaping destination via ../",
+			entries: []tarEntry{
+				{name: "evil", typeflag: tar.TypeSymlink, linkname: "../../../etc/passwd"},
+			},
+		},
+		{
+			name: "hardlink escaping destination",
+			entries: []tarEntry{
+				{name: "evil", typeflag: tar.TypeLink, linkname: "../../../etc/passwd"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstDir := t.TempDir()
+			err := extractTar(buildTar(t, tt.entries), dstDir, defaultExtractOptions)
+			if err == nil {
+				t.Fatalf("extractTar succeeded, want error rejecting the entry")
+			}
+		})
+	}
+}
+
+func TestExtractTarAllowsWellBehavedEntries(t *testing.T) {
+	dstDir := t.TempDir()
+	entries := []tarEntry{
+		{name: "sub", typeflag: tar.TypeDir},
+		{name: "sub/file.txt", typeflag: tar.TypeReg, body: "hello"},
+		{name: "link-to-file", typeflag: tar.TypeSymlink, linkname: "sub/file.txt"},
+		{name: "hardlink-to-file", typeflag: tar.TypeLink, linkname: "sub/file.txt"},
+	}
+
+	if err := extractTar(buildTar(t, entries), dstDir, defaultExtractOptions); err != nil {
+		t.Fatalf("extractTar failed on well-behaved archive: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dstDir, "sub", "file.txt"))
+	if err != nil {
+		t.Fatalf("reading extracted file: %v", err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("got file content %q, want %q", data, "hello")
+	}
+}
+
+func TestExtractTarEnforcesMaxEntries(t *testing.T) {
+	entries := []tarEntry{
+		{name: "a.txt", typeflag: tar.TypeReg, body: "a"},
+		{name: "b.txt", typeflag: tar.TypeReg, body: "b"},
+		{name: "c.txt", typeflag: tar.TypeReg, body: "c"},
+	}
+
+	dstDir := t.TempDir()
+	opts := ExtractOptions{MaxEntries: 2}
+	err := extractTar(buildTar(t, entries), dstDir, opts)
+	if err == nil {
+		t.Fatalf("extractTar succeeded, want error for exceeding MaxEntries")
+	}
+}
+
+func TestExtractTarEnforcesMaxSize(t *testing.T) {
+	entries := []tarEntry{
+		{name: "big.txt", typeflag: tar.TypeReg, body: "this file is much too large"},
+	}
+
+	dstDir := t.TempDir()
+	opts := ExtractOptions{MaxSize: 4}
+	err := extractTar(buildTar(t, entries), dstDir, opts)
+	if err == nil {
+		t.Fatalf("extractTar succeeded, want error for exceeding MaxSize")
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dstDir := "/tmp/opus-extract-dst"
+
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+	}{
+		{name: "plain relative path", entry: "opus-1.5.2/include/opus.h", wantErr: false},
+		{name: "traversal escapes destination", entry: "../../../etc/passwd", wantErr: true},
+		{name: "absolute path", entry: "/etc/passwd", wantErr: true},
+		{name: "clean internal traversal stays inside", entry: "a/b/../c", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := safeJoin(dstDir, tt.entry)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("safeJoin(%q) error = %v, wantErr %v", tt.entry, err, tt.wantErr)
+			}
+		})
+	}
+}